@@ -35,6 +35,12 @@ type CacheItem struct {
 	// Callback method triggered right before removing the item from the cache
 	//删除item之前回调此函数
 	aboutToExpire func(key interface{})
+
+	// The table this item was inserted into, if any. Used by KeepAlive to
+	// keep the table's expiration heap in sync with this item's deadline.
+	//该item所属的表(如果有的话), KeepAlive借助它让表的过期堆与本item的
+	//过期时间点保持同步;
+	table *CacheTable
 }
 
 // Returns a newly created CacheItem.
@@ -60,9 +66,28 @@ func CreateCacheItem(key interface{}, lifeSpan time.Duration, data interface{})
 //更新item访问时间和访问次数;
 func (item *CacheItem) KeepAlive() {
 	item.Lock()
-	defer item.Unlock()
 	item.accessedOn = time.Now()
 	item.accessCount++
+	table := item.table
+	lifeSpan := item.lifeSpan
+	accessedOn := item.accessedOn
+	item.Unlock()
+
+	// Push a fresh expiry-heap entry for the new deadline; the table
+	// lazily discards the one this superseded. Items with no lifeSpan never
+	// go in the heap, so skip the exclusive table lock entirely for them.
+	// rescheduleExpiry verifies item is still the table's live entry for its
+	// key before touching the heap, so a stale item reference (superseded by
+	// a later Add, or never actually admitted) can't corrupt the current
+	// entry's deadline.
+	//为新的过期时间点在堆中压入一个新条目; 表会惰性丢弃被取代的旧条目;
+	//无生命周期的item永远不会进入堆中, 因此这类item可以完全跳过表的独占锁;
+	//rescheduleExpiry在触碰堆之前会先确认item仍是表中该key当前存活的条目,
+	//因此一个过期的item引用(已被后续Add取代, 或从未真正被接纳)不会污染
+	//当前条目的过期时间;
+	if table != nil && lifeSpan > 0 {
+		table.rescheduleExpiry(item, lifeSpan, accessedOn)
+	}
 }
 
 // Returns this item's expiration duration.
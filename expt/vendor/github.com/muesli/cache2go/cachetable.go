@@ -8,9 +8,11 @@
 package cache2go
 
 import (
+	"container/heap"
 	"log"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -44,6 +46,68 @@ type CacheTable struct {
 	addedItem func(item *CacheItem)
 	// Callback method triggered before deleting an item from the cache.
 	aboutToDeleteItem func(item *CacheItem)
+
+	// The policy used to pick an eviction candidate once the table is at
+	// capacity. Nil means the table is allowed to grow without bound.
+	//淘汰策略, nil表示不限制容量
+	policy EvictionPolicy
+	// Maximum number of items the table may hold before policy is
+	// consulted. Zero (the default) means unbounded.
+	//容量上限, 0表示不限制
+	capacity int
+
+	// Whether concurrent Value calls for the same missing key should be
+	// deduplicated so loadData only runs once. Off by default to preserve
+	// the historical behavior of firing loadData for every caller.
+	//是否对loadData去重
+	loadDedup bool
+	// In-flight loadData calls, keyed by the key being loaded. Only used
+	// when loadDedup is enabled.
+	//进行中的loadData调用
+	loadCalls map[interface{}]*loadCall
+
+	// Running counters backing Stats(), updated atomically so reading
+	// them never needs the table lock.
+	//Stats()的计数器, 原子更新
+	statsHits        int64
+	statsMisses      int64
+	statsLoads       int64
+	statsLoadErrors  int64
+	statsEvictions   int64
+	statsExpirations int64
+	statsSize        int64
+
+	// Optional bridge to an external metrics system (Prometheus,
+	// OpenTelemetry, expvar, ...), notified alongside the counters above.
+	// Holds a *statsCollectorBox so it can be read from the record*
+	// helpers (which run without table's lock held) via atomic.Value.
+	//可选的外部指标桥接器, 以atomic.Value存储以支持无锁并发读取
+	statsCollector atomic.Value
+
+	// Min-heap of pending expirations, keyed by deadline, letting
+	// expirationCheck find the next item to expire in O(log n) instead
+	// of scanning every item on every tick.
+	//按过期时间排序的最小堆
+	expiryQueue expiryHeap
+	// Generation number of the live expiry-heap entry for each key with
+	// lifeSpan > 0, used to lazily discard entries superseded by a later
+	// KeepAlive/Add/Delete instead of searching the heap for them.
+	//过期堆条目的代数, 用于惰性删除
+	expiryGen map[interface{}]uint64
+	// Monotonically increasing counter used to mint the generation
+	// numbers above.
+	//生成代数的递增计数器
+	expirySeq uint64
+}
+
+// loadCall tracks a single in-flight loadData invocation so that
+// concurrent callers waiting on the same key can share its result instead
+// of each triggering their own call.
+//跟踪一次进行中的loadData调用, 供并发调用方共享结果
+type loadCall struct {
+	wg   sync.WaitGroup
+	item *CacheItem
+	err  error
 }
 
 // Returns how many items are currently stored in the cache.
@@ -101,64 +165,84 @@ func (table *CacheTable) SetLogger(logger *log.Logger) {
 	table.logger = logger
 }
 
+// SetEvictionPolicy configures the policy used to pick an eviction
+// candidate once the table reaches its capacity (see SetCapacity). Passing
+// nil disables eviction and lets the table grow without bound again.
+//设置淘汰策略, nil则关闭淘汰
+func (table *CacheTable) SetEvictionPolicy(p EvictionPolicy) {
+	table.Lock()
+	defer table.Unlock()
+	table.policy = p
+}
+
+// SetCapacity bounds how many items the table may hold. Once the limit is
+// reached, Add and NotFoundAdd consult the configured EvictionPolicy (see
+// SetEvictionPolicy) instead of inserting unconditionally. n <= 0 means
+// unbounded, which is also the default.
+//设置容量上限, n<=0表示不限制
+func (table *CacheTable) SetCapacity(n int) {
+	table.Lock()
+	defer table.Unlock()
+	table.capacity = n
+}
+
+// SetLoadDeduplication controls whether concurrent Value calls for a
+// missing key are deduplicated, so that loadData only runs once and every
+// caller waiting on that key receives the same *CacheItem/error pair. It's
+// off by default, matching the historical behavior where loadData fires
+// once per caller.
+//控制是否对并发Value调用去重
+func (table *CacheTable) SetLoadDeduplication(enable bool) {
+	table.Lock()
+	defer table.Unlock()
+	table.loadDedup = enable
+}
+
 // Expiration check loop, triggered by a self-adjusting timer.
-//通过自适应定时器 循环检测过期Item
-//检测逻辑
-//1.当清除定时器不为空时, 先关闭清除定时器, 即先关闭上次定时任务;
-//2.当清除时间间隔大于0时, 则下一次触发时间是隔一个间隔周期后, 触发日志记录;
-//3.循环遍历缓存项, 删除过期缓存项, 找到最近下一次删除的过期时间间隔;
-//4.更新过期时间间隔， 当这个时间间隔来临时再次触发过期时间检测;
+//通过自适应定时器循环检测过期item
 func (table *CacheTable) expirationCheck() {
 	table.Lock()
 	if table.cleanupTimer != nil {
 		table.cleanupTimer.Stop()
 	}
-	if table.cleanupInterval > 0 {
-		table.log("Expiration check triggered after", table.cleanupInterval, "for table", table.name)
-	} else {
-		table.log("Expiration check installed for table", table.name)
-	}
-
-	// Cache value so we don't keep blocking the mutex.
-	items := table.items
-	table.Unlock()
+	table.log("Expiration check installed for table", table.name)
 
-	// To be more accurate with timers, we would need to update 'now' on every
-	// loop iteration. Not sure it's really efficient though.
 	now := time.Now()
-	smallestDuration := 0 * time.Second
-	for key, item := range items {
-		// Cache values so we don't keep blocking the mutex.
-		item.RLock()
-		lifeSpan := item.lifeSpan
-		accessedOn := item.accessedOn
-		item.RUnlock()
-		//未设置过期时间，则忽略
-		if lifeSpan == 0 {
+	for table.expiryQueue.Len() > 0 {
+		entry := table.expiryQueue[0]
+		//懒删除: 条目已过期失效, 直接丢弃;
+		if table.expiryGen[entry.key] != entry.gen {
+			heap.Pop(&table.expiryQueue)
 			continue
 		}
-		//距离上次访问时间大于其生命周期，则过期，删除当前key
-		if now.Sub(accessedOn) >= lifeSpan {
-			// Item has excessed its lifespan.
-			table.Delete(key)
-		} else {
-			// Find the item chronologically closest to its end-of-lifespan.
-			//找到所有item中距离其生命周期最近的间隔时间
-			//当存在一个Item, 其生命周期时间减去上次访问时间的时间间隔小于当前记录的最小时间间隔, 则更新为当前记录的最小时间间隔;
-			if smallestDuration == 0 || lifeSpan-now.Sub(accessedOn) < smallestDuration {
-				smallestDuration = lifeSpan - now.Sub(accessedOn)
-			}
+		//堆顶尚未到期, 停止弹出;
+		if entry.deadline.After(now) {
+			break
 		}
+
+		heap.Pop(&table.expiryQueue)
+		delete(table.expiryGen, entry.key)
+		table.log("Expiration check triggered for key", entry.key, "in table", table.name)
+
+		table.Unlock()
+		table.Delete(entry.key)
+		table.recordExpiration()
+		table.Lock()
 	}
 
-	// Setup the interval for the next cleanup run.
-	table.Lock()
-	table.cleanupInterval = smallestDuration
-	if smallestDuration > 0 {
-		//time.AfterFunc 会在当前协程内调用func(go table.expirationCheck())方法
-		table.cleanupTimer = time.AfterFunc(smallestDuration, func() {
+	// Setup the timer for the next cleanup run, from whatever is now at
+	// the top of the heap.
+	if table.expiryQueue.Len() > 0 {
+		nextIn := table.expiryQueue[0].deadline.Sub(now)
+		if nextIn < 0 {
+			nextIn = 0
+		}
+		table.cleanupInterval = nextIn
+		table.cleanupTimer = time.AfterFunc(nextIn, func() {
 			go table.expirationCheck()
 		})
+	} else {
+		table.cleanupInterval = 0
 	}
 	table.Unlock()
 }
@@ -172,26 +256,47 @@ func (table *CacheTable) expirationCheck() {
 //当过了一个lifeSpan 还没有被访问过, 则会把这个key从缓存中removed掉;
 func (table *CacheTable) Add(key interface{}, lifeSpan time.Duration, data interface{}) *CacheItem {
 	item := CreateCacheItem(key, lifeSpan, data)
+	item.table = table
 
-	// Add item to cache.
+	// The whole decide-evict-insert sequence must happen under a single
+	// Lock, otherwise concurrent callers can all observe room at capacity
+	// and all insert before any of them is reflected back.
+	//decide-evict-insert必须在同一次Lock内完成, 避免并发调用方都越过容量检查;
 	table.Lock()
-	//触发添加日志;
+	victim, isNew, admitted := table.admitLocked(key)
+	if !admitted {
+		table.Unlock()
+		return &item
+	}
 	table.log("Adding item with key", key, "and lifespan of", lifeSpan, "to table", table.name)
 	table.items[key] = &item
+	table.scheduleExpiryLocked(key, lifeSpan, item.accessedOn)
+	policy := table.policy
 
 	// Cache values so we don't keep blocking the mutex.
 	expDur := table.cleanupInterval
 	addedItem := table.addedItem
+	aboutToDeleteItem := table.aboutToDeleteItem
 	table.Unlock()
 
+	table.notifyEvicted(victim, aboutToDeleteItem)
+	if victim != nil {
+		table.recordEviction()
+	}
+	if isNew {
+		table.recordSizeDelta(1)
+	}
+
+	if policy != nil {
+		policy.Touch(&item)
+	}
+
 	// Trigger callback after adding an item to cache.
-	//当设置了回调函数后, 则触发回调函数;
 	if addedItem != nil {
 		addedItem(&item)
 	}
 
 	// If we haven't set up any expiration check timer or found a more imminent item.
-	//如果设置了生命周期, 并且表格清除检测时间间隔为0,或者生命周期小于清除间隔 则理解触发过期检测;
 	if lifeSpan > 0 && (expDur == 0 || lifeSpan < expDur) {
 		table.expirationCheck()
 	}
@@ -199,6 +304,67 @@ func (table *CacheTable) Add(key interface{}, lifeSpan time.Duration, data inter
 	return &item
 }
 
+// admitLocked decides whether key may be inserted given the table's
+// capacity and EvictionPolicy, evicting the policy's chosen candidate from
+// items/expiryQueue/policy right away if that's what makes room. It returns
+// the evicted item (nil if none was evicted), whether key is a new entry
+// (false when this call would overwrite an existing one, so the caller
+// must not double-count it in statsSize), and whether key is admitted; the
+// caller still owns firing the evicted item's callbacks, recording the
+// eviction, and adjusting statsSize, all without the table lock held, since
+// StatsCollector callbacks must not run while it's held. Must be called
+// with the table lock held, so the whole check-evict-insert sequence stays
+// atomic across concurrent callers.
+//决定是否接纳key, 需要时立即淘汰策略选中的候选者; 调用时必须持有表锁;
+//调用方需在释放锁后才触发淘汰回调/记录淘汰/调整statsSize;
+func (table *CacheTable) admitLocked(key interface{}) (victim *CacheItem, isNew bool, admitted bool) {
+	policy := table.policy
+	capacity := table.capacity
+	_, exists := table.items[key]
+	isNew = !exists
+	atCapacity := capacity > 0 && !exists && len(table.items) >= capacity
+	if policy == nil || !atCapacity {
+		return nil, isNew, true
+	}
+
+	victimKey, ok := policy.Evict(table.items)
+	if !ok {
+		// Nothing the policy can evict; let the table grow past capacity
+		// rather than silently dropping the new item.
+		return nil, isNew, true
+	}
+
+	if !policy.Admit(key, victimKey, table.items) {
+		return nil, isNew, false
+	}
+
+	victim = table.items[victimKey]
+	table.removeLocked(victimKey)
+	return victim, isNew, true
+}
+
+// notifyEvicted fires the about-to-delete callbacks for an item admitLocked
+// evicted, mirroring what Delete does for an explicit removal. victim may be
+// nil, in which case this is a no-op. Must be called without the table lock
+// held.
+//为被淘汰的item触发回调, victim为nil时不做任何事;
+func (table *CacheTable) notifyEvicted(victim *CacheItem, aboutToDeleteItem func(item *CacheItem)) {
+	if victim == nil {
+		return
+	}
+
+	if aboutToDeleteItem != nil {
+		aboutToDeleteItem(victim)
+	}
+	victim.RLock()
+	if victim.aboutToExpire != nil {
+		victim.aboutToExpire(victim.key)
+	}
+	victim.RUnlock()
+
+	table.recordSizeDelta(-1)
+}
+
 // Delete an item from the cache.
 func (table *CacheTable) Delete(key interface{}) (*CacheItem, error) {
 	table.RLock()
@@ -227,14 +393,27 @@ func (table *CacheTable) Delete(key interface{}) (*CacheItem, error) {
 	}
 
 	table.Lock()
-	defer table.Unlock()
 	table.log("Deleting item with key", key, "created on", r.createdOn, "and hit", r.accessCount, "times from table", table.name)
 	//真正删除相应key的item
-	delete(table.items, key)
+	table.removeLocked(key)
+	table.Unlock()
+
+	table.recordSizeDelta(-1)
 
 	return r, nil
 }
 
+// removeLocked drops key's item from items along with its expiry-heap and
+// eviction-policy bookkeeping. Must be called with the table lock held.
+//清理key的item及其过期堆/策略记录; 调用时必须持有表锁;
+func (table *CacheTable) removeLocked(key interface{}) {
+	delete(table.items, key)
+	table.invalidateExpiryLocked(key)
+	if table.policy != nil {
+		table.policy.Remove(key)
+	}
+}
+
 // Test whether an item exists in the cache. Unlike the Value method
 // Exists neither tries to fetch data via the loadData callback nor
 // does it keep the item alive in the cache.
@@ -252,6 +431,11 @@ func (table *CacheTable) Exists(key interface{}) bool {
 // NotExistsAdd also add data if not found.
 //检查在cache是否没有item， 与Exists不同的是, 当item不存在时, NotFoundAdd会添加这个key的item;
 func (table *CacheTable) NotFoundAdd(key interface{}, lifeSpan time.Duration, data interface{}) bool {
+	// The existence check, eviction decision and insertion all happen
+	// under one Lock below, for the same reason Add does it: otherwise
+	// concurrent callers for distinct keys can all pass the capacity gate
+	// before any of them is reflected back.
+	//存在性检查、淘汰决策和插入都在同一次Lock内完成, 原因同Add;
 	table.Lock()
     //当表中存在名为key的item 则直接返回false;
 	if _, ok := table.items[key]; ok {
@@ -259,15 +443,37 @@ func (table *CacheTable) NotFoundAdd(key interface{}, lifeSpan time.Duration, da
 		return false
 	}
 
+	// key was just confirmed absent above, so admitLocked's isNew is
+	// always true here and doesn't need checking.
+	victim, _, admitted := table.admitLocked(key)
+	if !admitted {
+		table.Unlock()
+		return false
+	}
+
 	item := CreateCacheItem(key, lifeSpan, data)
+	item.table = table
 	table.log("Adding item with key", key, "and lifespan of", lifeSpan, "to table", table.name)
 	table.items[key] = &item
+	table.scheduleExpiryLocked(key, lifeSpan, item.accessedOn)
+	policy := table.policy
 
 	// Cache values so we don't keep blocking the mutex.
 	expDur := table.cleanupInterval
 	addedItem := table.addedItem
+	aboutToDeleteItem := table.aboutToDeleteItem
 	table.Unlock()
 
+	table.notifyEvicted(victim, aboutToDeleteItem)
+	if victim != nil {
+		table.recordEviction()
+	}
+	table.recordSizeDelta(1)
+
+	if policy != nil {
+		policy.Touch(&item)
+	}
+
 	// Trigger callback after adding an item to cache.
 	//触发添加回调;
 	if addedItem != nil {
@@ -289,46 +495,120 @@ func (table *CacheTable) Value(key interface{}, args ...interface{}) (*CacheItem
 	table.RLock()
 	r, ok := table.items[key]
 	loadData := table.loadData
+	policy := table.policy
+	loadDedup := table.loadDedup
 	table.RUnlock()
 
 	if ok {
 		// Update access counter and timestamp.
 		//如果访问的值存在, 则更新其访问次数及访问时间, 并返回;
 		r.KeepAlive()
+		if policy != nil {
+			policy.Touch(r)
+		}
+		table.recordHit()
 		return r, nil
 	}
+	table.recordMiss()
 
 	// Item doesn't exist in cache. Try and fetch it with a data-loader.
 	//当值不存在缓存中时, 尝试去加载数据;
 	//当设置了数据加载源函数时, 则取加载数据;
-	if loadData != nil {
-		item := loadData(key, args...)
-		//当加载成功时, 则更新到当前缓存中;
-		if item != nil {
-			table.Add(key, item.lifeSpan, item.data)
-			return item, nil
-		}
-        //返回key不存在, 也不在加载数据源中;
-		return nil, ErrKeyNotFoundOrLoadable
+	if loadData == nil {
+		//返回key不存在;
+		return nil, ErrKeyNotFound
+	}
+
+	if loadDedup {
+		//去重时共享同一次loadData结果;
+		return table.loadDataOnce(key, args...)
 	}
 
-    //返回key不存在;
-	return nil, ErrKeyNotFound
+	start := time.Now()
+	item := loadData(key, args...)
+	table.recordLoad(time.Since(start), item != nil)
+	//当加载成功时, 则更新到当前缓存中;
+	if item != nil {
+		table.Add(key, item.lifeSpan, item.data)
+		return item, nil
+	}
+    //返回key不存在, 也不在加载数据源中;
+	return nil, ErrKeyNotFoundOrLoadable
+}
+
+// loadDataOnce runs the table's loadData callback for key at most once
+// across concurrent callers: the first caller to arrive performs the call
+// and stores the item in the cache as usual, while every other caller
+// waiting on the same key blocks until it completes and shares its result.
+//对同一个key最多只执行一次loadData调用, 其余调用方阻塞等待并共享结果;
+func (table *CacheTable) loadDataOnce(key interface{}, args ...interface{}) (*CacheItem, error) {
+	table.Lock()
+	if table.loadCalls == nil {
+		table.loadCalls = make(map[interface{}]*loadCall)
+	}
+	if call, inflight := table.loadCalls[key]; inflight {
+		table.Unlock()
+		call.wg.Wait()
+		return call.item, call.err
+	}
+	//之前的调用可能已在本调用方未命中后完成加载, 此时直接返回已缓存的item;
+	if r, ok := table.items[key]; ok {
+		table.Unlock()
+		r.KeepAlive()
+		return r, nil
+	}
+
+	call := &loadCall{}
+	call.wg.Add(1)
+	table.loadCalls[key] = call
+	loadData := table.loadData
+	table.Unlock()
+
+	start := time.Now()
+	item := loadData(key, args...)
+	table.recordLoad(time.Since(start), item != nil)
+	if item != nil {
+		table.Add(key, item.lifeSpan, item.data)
+		call.item = item
+	} else {
+		call.err = ErrKeyNotFoundOrLoadable
+	}
+
+	table.Lock()
+	delete(table.loadCalls, key)
+	table.Unlock()
+	call.wg.Done()
+
+	return call.item, call.err
 }
 
 // Delete all items from cache.
 //删除表中所有的缓存项, 并且关闭表定时器;
 func (table *CacheTable) Flush() {
 	table.Lock()
-	defer table.Unlock()
 
 	table.log("Flushing table", table.name)
 
+	if table.policy != nil {
+		for key := range table.items {
+			table.policy.Remove(key)
+		}
+	}
 	table.items = make(map[interface{}]*CacheItem)
 	table.cleanupInterval = 0
 	if table.cleanupTimer != nil {
 		table.cleanupTimer.Stop()
 	}
+	table.expiryQueue = nil
+	table.expiryGen = nil
+	atomic.StoreInt64(&table.statsSize, 0)
+	table.Unlock()
+
+	// StatsCollector callbacks must run without the table lock held, see
+	// StatsCollector's doc comment.
+	if c := table.collector(); c != nil {
+		c.SetSize(0)
+	}
 }
 
 //CacheItem对
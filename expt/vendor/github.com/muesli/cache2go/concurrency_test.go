@@ -0,0 +1,40 @@
+package cache2go
+
+import (
+	"sync"
+	"testing"
+)
+
+// newTestTable returns a CacheTable ready to use, the way NewShardedTable
+// builds its per-shard tables, since this package has no Cache(name)
+// constructor of its own.
+func newTestTable(name string) *CacheTable {
+	return &CacheTable{
+		name:  name,
+		items: make(map[interface{}]*CacheItem),
+	}
+}
+
+// Run with -race: 50 concurrent Adds of distinct keys against a table
+// capped at 10 must never let more than 10 items land in the table at once,
+// since admitLocked's decide-evict-insert sequence is supposed to be atomic.
+func TestAddEnforcesCapacityUnderConcurrency(t *testing.T) {
+	table := newTestTable("capacity")
+	table.SetEvictionPolicy(NewLRUPolicy())
+	table.SetCapacity(10)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			table.Add(i, 0, i)
+		}()
+	}
+	wg.Wait()
+
+	if count := table.Count(); count != 10 {
+		t.Fatalf("Count() = %d, want 10 (capacity must never be exceeded)", count)
+	}
+}
@@ -0,0 +1,268 @@
+/*
+ * Simple caching library with expiration capabilities
+ *     Copyright (c) 2013, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE.txt
+ */
+
+package cache2go
+
+import (
+	"container/list"
+	"sync"
+)
+
+// EvictionPolicy decides which item a capacity-bounded CacheTable evicts to
+// make room for a new one, and whether a new item should be admitted at
+// all. Remove/Evict/Admit are consulted while the table's lock is held, so
+// they must not call back into the CacheTable. Touch is the exception: it
+// runs from Add/Value without the table lock held, so implementations must
+// synchronize their own state against concurrent Touch calls.
+//淘汰策略接口; Remove/Evict/Admit在持有表锁时被调用, 不能回调CacheTable;
+//Touch是例外, 在Add/Value中不持有表锁时调用, 实现需自行同步状态;
+type EvictionPolicy interface {
+	// Touch is invoked whenever item is added or accessed, so the policy
+	// can update whatever recency/frequency bookkeeping it needs. Unlike
+	// the other methods below, it's called without the table lock held.
+	Touch(item *CacheItem)
+	// Remove is invoked whenever key leaves the table, e.g. via Delete,
+	// Flush, expiration, or an eviction this policy picked through Evict.
+	Remove(key interface{})
+	// Evict picks the item to remove from items to make room for a new
+	// insertion. It returns false if it has no eviction candidate.
+	Evict(items map[interface{}]*CacheItem) (key interface{}, ok bool)
+	// Admit is consulted before inserting newKey into a table that is
+	// already at capacity and has picked evictKey as the item it would
+	// otherwise evict. Returning false keeps the table's current content
+	// and drops the new item instead of evicting evictKey.
+	Admit(newKey, evictKey interface{}, items map[interface{}]*CacheItem) bool
+}
+
+// lruPolicy evicts the least recently touched item, tracked with a
+// doubly-linked list ordered by recency.
+//LRU策略, 双向链表按最近访问排列, 淘汰链表尾部;
+type lruPolicy struct {
+	mu    sync.Mutex
+	ll    *list.List
+	elems map[interface{}]*list.Element
+}
+
+// NewLRUPolicy returns an EvictionPolicy that evicts the least recently
+// used item once the table it's attached to is at capacity.
+func NewLRUPolicy() EvictionPolicy {
+	return &lruPolicy{
+		ll:    list.New(),
+		elems: make(map[interface{}]*list.Element),
+	}
+}
+
+func (p *lruPolicy) Touch(item *CacheItem) {
+	key := item.key
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if e, ok := p.elems[key]; ok {
+		p.ll.MoveToFront(e)
+		return
+	}
+	p.elems[key] = p.ll.PushFront(key)
+}
+
+func (p *lruPolicy) Remove(key interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if e, ok := p.elems[key]; ok {
+		p.ll.Remove(e)
+		delete(p.elems, key)
+	}
+}
+
+func (p *lruPolicy) Evict(items map[interface{}]*CacheItem) (interface{}, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	//从链表尾部找一个仍在items中的key;
+	for e := p.ll.Back(); e != nil; e = e.Prev() {
+		if _, ok := items[e.Value]; ok {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+func (p *lruPolicy) Admit(newKey, evictKey interface{}, items map[interface{}]*CacheItem) bool {
+	return true
+}
+
+// lfuPolicy evicts the item with the lowest access count, reusing
+// CacheItem's own accessCount rather than keeping a separate tally.
+//LFU策略, 复用accessCount, 淘汰访问次数最少的item;
+type lfuPolicy struct{}
+
+// NewLFUPolicy returns an EvictionPolicy that evicts the least frequently
+// used item, as measured by CacheItem.AccessCount.
+func NewLFUPolicy() EvictionPolicy {
+	return lfuPolicy{}
+}
+
+func (lfuPolicy) Touch(item *CacheItem) {}
+
+func (lfuPolicy) Remove(key interface{}) {}
+
+func (lfuPolicy) Evict(items map[interface{}]*CacheItem) (interface{}, bool) {
+	var (
+		victim interface{}
+		lowest int64
+		found  bool
+	)
+	for key, item := range items {
+		count := item.AccessCount()
+		if !found || count < lowest {
+			victim, lowest, found = key, count, true
+		}
+	}
+	return victim, found
+}
+
+func (lfuPolicy) Admit(newKey, evictKey interface{}, items map[interface{}]*CacheItem) bool {
+	return true
+}
+
+// tinyLFUPolicy layers a W-TinyLFU admission filter on top of LRU eviction
+// order: a new key is only admitted over the LRU candidate if the sketch
+// estimates it to be accessed more often.
+//W-TinyLFU策略, 在LRU之上加一层count-min sketch准入过滤;
+type tinyLFUPolicy struct {
+	lru    *lruPolicy
+	sketch *countMinSketch
+}
+
+// NewTinyLFUPolicy returns a W-TinyLFU EvictionPolicy. estimatedItems should
+// be a rough upper bound on the number of distinct keys the table will see;
+// it only sizes the internal count-min sketch and doesn't cap capacity.
+func NewTinyLFUPolicy(estimatedItems int) EvictionPolicy {
+	return &tinyLFUPolicy{
+		lru:    NewLRUPolicy().(*lruPolicy),
+		sketch: newCountMinSketch(estimatedItems),
+	}
+}
+
+func (p *tinyLFUPolicy) Touch(item *CacheItem) {
+	p.sketch.add(item.key)
+	p.lru.Touch(item)
+}
+
+func (p *tinyLFUPolicy) Remove(key interface{}) {
+	p.lru.Remove(key)
+}
+
+func (p *tinyLFUPolicy) Evict(items map[interface{}]*CacheItem) (interface{}, bool) {
+	return p.lru.Evict(items)
+}
+
+func (p *tinyLFUPolicy) Admit(newKey, evictKey interface{}, items map[interface{}]*CacheItem) bool {
+	if evictKey == nil {
+		return true
+	}
+	p.sketch.add(newKey)
+	return p.sketch.estimate(newKey) > p.sketch.estimate(evictKey)
+}
+
+// cmsDepth is the number of independent hash rows in the count-min sketch.
+// Four rows keeps collisions rare without much memory or CPU overhead.
+const cmsDepth = 4
+
+// countMinSketch is a 4-bit-counter count-min sketch used to estimate how
+// often a key has been seen recently, without storing one counter per key.
+// tinyLFUPolicy calls add from Touch without the table lock held, while
+// Admit calls add/estimate with it held, so the sketch guards its own state
+// with mu.
+//4-bit计数的count-min sketch, 估算key的近期访问频率; 自身用mu保护状态;
+type countMinSketch struct {
+	mu    sync.Mutex
+	width uint64
+	rows  [cmsDepth][]byte // two 4-bit counters packed per byte
+	seeds [cmsDepth]uint64
+	adds  uint64
+}
+
+func newCountMinSketch(estimatedItems int) *countMinSketch {
+	width := uint64(estimatedItems) * 4
+	if width < 64 {
+		width = 64
+	}
+
+	s := &countMinSketch{width: width}
+	for i := 0; i < cmsDepth; i++ {
+		s.rows[i] = make([]byte, (width+1)/2)
+		s.seeds[i] = uint64(2*i+1) * 0x9E3779B97F4A7C15
+	}
+	return s
+}
+
+func (s *countMinSketch) add(key interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := 0; i < cmsDepth; i++ {
+		s.increment(i, s.index(i, key))
+	}
+
+	s.adds++
+	//每width*depth次插入做一次老化;
+	if s.adds%(s.width*cmsDepth) == 0 {
+		s.age()
+	}
+}
+
+func (s *countMinSketch) estimate(key interface{}) byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	min := byte(15)
+	for i := 0; i < cmsDepth; i++ {
+		if c := s.get(i, s.index(i, key)); c < min {
+			min = c
+		}
+	}
+	return min
+}
+
+func (s *countMinSketch) index(row int, key interface{}) uint64 {
+	h := hashInterfaceKey(key) ^ s.seeds[row]
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	return h % s.width
+}
+
+func (s *countMinSketch) get(row int, idx uint64) byte {
+	b := s.rows[row][idx/2]
+	if idx%2 == 0 {
+		return b & 0x0F
+	}
+	return b >> 4
+}
+
+func (s *countMinSketch) increment(row int, idx uint64) {
+	cur := s.get(row, idx)
+	if cur >= 15 {
+		return
+	}
+
+	bi := idx / 2
+	if idx%2 == 0 {
+		s.rows[row][bi] = (s.rows[row][bi] &^ 0x0F) | (cur + 1)
+	} else {
+		s.rows[row][bi] = (s.rows[row][bi] &^ 0xF0) | ((cur + 1) << 4)
+	}
+}
+
+func (s *countMinSketch) age() {
+	for i := 0; i < cmsDepth; i++ {
+		row := s.rows[i]
+		for j := range row {
+			lo := (row[j] & 0x0F) >> 1
+			hi := (row[j] >> 4) >> 1
+			row[j] = lo | (hi << 4)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+/*
+ * Simple caching library with expiration capabilities
+ *     Copyright (c) 2013, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE.txt
+ */
+
+package cache2go
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/fnv"
+)
+
+// stableHash produces a stable 64-bit hash for the concrete types most
+// commonly used as cache keys (strings, byte slices, int, int32, int64, uint,
+// uint32 and uint64). It returns ok == false for any other type, including
+// the 8- and 16-bit integer types, leaving the
+// caller to decide on a fallback.
+//为常见key类型计算一个稳定的64位哈希值; 对于其它类型返回ok == false, 由调用方决定如何兜底;
+func stableHash(key interface{}) (h uint64, ok bool) {
+	sum := fnv.New64a()
+
+	switch k := key.(type) {
+	case string:
+		sum.Write([]byte(k))
+	case []byte:
+		sum.Write(k)
+	case int:
+		writeUint64(sum, uint64(k))
+	case int32:
+		writeUint64(sum, uint64(k))
+	case int64:
+		writeUint64(sum, uint64(k))
+	case uint:
+		writeUint64(sum, uint64(k))
+	case uint32:
+		writeUint64(sum, uint64(k))
+	case uint64:
+		writeUint64(sum, k)
+	default:
+		return 0, false
+	}
+
+	return sum.Sum64(), true
+}
+
+// hashInterfaceKey hashes any key, falling back to hashing its string
+// representation when it isn't one of the types stableHash knows about.
+//对任意key求哈希, 当其类型不在stableHash已知的类型列表中时, 退化为对其字符串表示求哈希;
+func hashInterfaceKey(key interface{}) uint64 {
+	if h, ok := stableHash(key); ok {
+		return h
+	}
+
+	sum := fnv.New64a()
+	fmt.Fprintf(sum, "%v", key)
+	return sum.Sum64()
+}
+
+func writeUint64(h hash.Hash64, v uint64) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	h.Write(buf[:])
+}
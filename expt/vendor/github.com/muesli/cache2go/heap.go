@@ -0,0 +1,101 @@
+/*
+ * Simple caching library with expiration capabilities
+ *     Copyright (c) 2013, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE.txt
+ */
+
+package cache2go
+
+import (
+	"container/heap"
+	"time"
+)
+
+// expiryEntry is one pending expiration in a CacheTable's expiryQueue: key
+// is due to expire at deadline, unless gen no longer matches the table's
+// current generation for that key, in which case this entry is stale and
+// must be discarded without touching the item (lazy deletion).
+//expiryQueue中的一个待过期条目, gen用于惰性删除失效条目;
+type expiryEntry struct {
+	key      interface{}
+	deadline time.Time
+	gen      uint64
+	index    int
+}
+
+// expiryHeap is a min-heap of expiryEntry ordered by deadline, implementing
+// container/heap.Interface.
+//按deadline排序的expiryEntry最小堆;
+type expiryHeap []*expiryEntry
+
+func (h expiryHeap) Len() int { return len(h) }
+
+func (h expiryHeap) Less(i, j int) bool { return h[i].deadline.Before(h[j].deadline) }
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap) Push(x interface{}) {
+	entry := x.(*expiryEntry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	entry := old[n-1]
+	old[n-1] = nil
+	entry.index = -1
+	*h = old[:n-1]
+	return entry
+}
+
+// scheduleExpiryLocked (re)schedules key's expiration against accessedOn +
+// lifeSpan, superseding whatever entry previously existed for key. A
+// lifeSpan of 0 means key never expires, so it's kept out of the heap
+// entirely. Must be called with the table lock held.
+//以accessedOn+lifeSpan安排key的过期, lifeSpan为0则永不过期; 调用时必须持有表锁;
+func (table *CacheTable) scheduleExpiryLocked(key interface{}, lifeSpan time.Duration, accessedOn time.Time) {
+	if table.expiryGen == nil {
+		table.expiryGen = make(map[interface{}]uint64)
+	}
+
+	if lifeSpan <= 0 {
+		delete(table.expiryGen, key)
+		return
+	}
+
+	table.expirySeq++
+	gen := table.expirySeq
+	table.expiryGen[key] = gen
+	heap.Push(&table.expiryQueue, &expiryEntry{key: key, deadline: accessedOn.Add(lifeSpan), gen: gen})
+}
+
+// invalidateExpiryLocked marks whatever expiry-heap entry exists for key as
+// stale, e.g. because the item was deleted outright. Must be called with
+// the table lock held.
+//将key现有的过期堆条目标记为失效; 调用时必须持有表锁;
+func (table *CacheTable) invalidateExpiryLocked(key interface{}) {
+	delete(table.expiryGen, key)
+}
+
+// rescheduleExpiry is the locking wrapper KeepAlive uses to push a fresh
+// expiry-heap entry without having to reach into the table's internals
+// itself. It first checks that item is still the table's current entry for
+// its key, so a stale *CacheItem (e.g. one overwritten by a later Add, or
+// one an EvictionPolicy declined to admit) can't stomp the live entry's
+// deadline.
+//先确认item仍是该key当前存活的条目, 避免过期的item引用篡改当前的过期时间;
+func (table *CacheTable) rescheduleExpiry(item *CacheItem, lifeSpan time.Duration, accessedOn time.Time) {
+	table.Lock()
+	defer table.Unlock()
+	if table.items[item.key] != item {
+		return
+	}
+	table.scheduleExpiryLocked(item.key, lifeSpan, accessedOn)
+}
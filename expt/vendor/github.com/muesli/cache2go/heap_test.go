@@ -0,0 +1,24 @@
+package cache2go
+
+import (
+	"testing"
+	"time"
+)
+
+// KeepAlive on a stale *CacheItem (one that no longer matches the table's
+// current entry for its key) must not reschedule the live entry's
+// expiration to the stale item's deadline.
+func TestKeepAliveIgnoresStaleItem(t *testing.T) {
+	table := newTestTable("stale-keepalive")
+
+	stale := table.Add("k", 20*time.Millisecond, "v1")
+	table.Add("k", 10*time.Second, "v2")
+
+	stale.KeepAlive()
+
+	time.Sleep(50 * time.Millisecond)
+
+	if !table.Exists("k") {
+		t.Fatal("key expired early: stale item's KeepAlive stomped the live entry's deadline")
+	}
+}
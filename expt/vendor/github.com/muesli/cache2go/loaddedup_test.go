@@ -0,0 +1,53 @@
+package cache2go
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// Run with -race: with SetLoadDeduplication(true), concurrent Value calls
+// for the same missing key must invoke loadData exactly once, and every
+// caller must receive an item holding the loaded data.
+func TestLoadDeduplicationRunsLoaderOnce(t *testing.T) {
+	table := newTestTable("load-dedup")
+	table.SetLoadDeduplication(true)
+
+	var calls int64
+	release := make(chan struct{})
+	table.SetDataLoader(func(key interface{}, args ...interface{}) *CacheItem {
+		atomic.AddInt64(&calls, 1)
+		<-release
+		item := CreateCacheItem(key, 0, "loaded")
+		return &item
+	})
+
+	const n = 20
+	var wg sync.WaitGroup
+	results := make([]*CacheItem, n)
+	for i := 0; i < n; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			item, err := table.Value("k")
+			if err != nil {
+				t.Errorf("Value() error = %v, want loaded item", err)
+				return
+			}
+			results[i] = item
+		}()
+	}
+
+	close(release)
+	wg.Wait()
+
+	if got := atomic.LoadInt64(&calls); got != 1 {
+		t.Fatalf("loadData called %d times, want 1", got)
+	}
+	for i, item := range results {
+		if item == nil || item.Data() != "loaded" {
+			t.Fatalf("results[%d] = %v, want item with Data() == \"loaded\"", i, item)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+/*
+ * Simple caching library with expiration capabilities
+ *     Copyright (c) 2013, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE.txt
+ */
+
+package cache2go
+
+import (
+	"encoding/gob"
+	"io"
+	"os"
+	"time"
+)
+
+// persistedItem is the on-disk representation of a CacheItem. Only the
+// fields needed to faithfully recreate an item are kept. ExpiresAt stores
+// the absolute deadline (accessedOn + lifeSpan) rather than a bare
+// duration, so LoadFrom can tell whether an item has expired in the time
+// between the save and the load, regardless of how long that gap was; the
+// zero value means the item never expires.
+//CacheItem的持久化表示; ExpiresAt存绝对时间点, 零值表示永不过期;
+type persistedItem struct {
+	Key         interface{}
+	Data        interface{}
+	CreatedOn   time.Time
+	AccessedOn  time.Time
+	AccessCount int64
+	ExpiresAt   time.Time
+}
+
+// RegisterType registers a concrete type with encoding/gob so it can be
+// used as a cache key or value across SaveTo/LoadFrom. It's a thin
+// convenience wrapper around gob.Register; call it once per concrete type
+// before the first Save, typically from an init function.
+//向gob注册一个具体类型, 以便作为key/value参与SaveTo/LoadFrom;
+func RegisterType(v interface{}) {
+	gob.Register(v)
+}
+
+// SaveTo writes every live item in the table to w as a gob stream. Because
+// keys and values are stored as interface{}, their concrete types must
+// have been registered with RegisterType (or gob.Register directly)
+// beforehand, or encoding/gob will fail to encode them.
+//将所有存活item以gob流写入w; key/value类型需提前通过RegisterType注册;
+func (table *CacheTable) SaveTo(w io.Writer) error {
+	table.RLock()
+	items := make([]persistedItem, 0, len(table.items))
+	for _, item := range table.items {
+		item.RLock()
+		var expiresAt time.Time
+		if item.lifeSpan > 0 {
+			expiresAt = item.accessedOn.Add(item.lifeSpan)
+		}
+		items = append(items, persistedItem{
+			Key:         item.key,
+			Data:        item.data,
+			CreatedOn:   item.createdOn,
+			AccessedOn:  item.accessedOn,
+			AccessCount: item.accessCount,
+			ExpiresAt:   expiresAt,
+		})
+		item.RUnlock()
+	}
+	table.RUnlock()
+
+	return gob.NewEncoder(w).Encode(items)
+}
+
+// SaveToFile is a convenience wrapper around SaveTo that (over)writes path.
+//SaveTo的便捷封装, 覆盖写入path;
+func (table *CacheTable) SaveToFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return table.SaveTo(f)
+}
+
+// LoadFrom reads a gob stream previously written by SaveTo/SaveToFile and
+// merges its items into the table, replacing any existing item that shares
+// a key. Items whose remaining lifespan already elapsed while the table was
+// unloaded are dropped instead of being restored, and the expiration timer
+// is re-armed for whatever remains via expirationCheck. Items are merged in
+// through Add, so a capacity-bounded table's eviction policy sees restored
+// items exactly like freshly-added ones, and Stats().Size stays accurate.
+// As with SaveTo, the concrete key/value types must already be registered
+// with RegisterType.
+//读取SaveTo/SaveToFile写入的gob流, 合并进表中, 已耗尽生命周期的item会被丢弃;
+//item通过Add合并, 因此容量/淘汰策略对恢复的item与新item一视同仁;
+func (table *CacheTable) LoadFrom(r io.Reader) error {
+	var items []persistedItem
+	if err := gob.NewDecoder(r).Decode(&items); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, pi := range items {
+		lifeSpan := time.Duration(0)
+		if !pi.ExpiresAt.IsZero() {
+			lifeSpan = pi.ExpiresAt.Sub(now)
+			//生命周期已耗尽, 丢弃而不恢复;
+			if lifeSpan <= 0 {
+				continue
+			}
+		}
+
+		item := table.Add(pi.Key, lifeSpan, pi.Data)
+		item.Lock()
+		item.createdOn = pi.CreatedOn
+		item.accessedOn = pi.AccessedOn
+		item.accessCount = pi.AccessCount
+		//以原accessedOn为起点恢复完整生命周期, 使accessedOn+lifeSpan仍等于ExpiresAt;
+		if !pi.ExpiresAt.IsZero() {
+			item.lifeSpan = pi.ExpiresAt.Sub(pi.AccessedOn)
+		}
+		item.Unlock()
+	}
+
+	table.expirationCheck()
+	return nil
+}
+
+// LoadFromFile is a convenience wrapper around LoadFrom that reads path.
+//LoadFrom的便捷封装, 从path读取;
+func (table *CacheTable) LoadFromFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return table.LoadFrom(f)
+}
@@ -0,0 +1,78 @@
+package cache2go
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func init() {
+	RegisterType("")
+}
+
+// Round-trip through SaveTo/LoadFrom must preserve a live item's data,
+// createdOn, accessedOn and accessCount, and the restored item must keep
+// expiring on its original (not a reset) deadline.
+func TestSaveToLoadFromRoundTrip(t *testing.T) {
+	src := newTestTable("persist-src")
+	item := src.Add("k", time.Hour, "v")
+	item.Lock()
+	item.accessCount = 3
+	item.Unlock()
+
+	var buf bytes.Buffer
+	if err := src.SaveTo(&buf); err != nil {
+		t.Fatalf("SaveTo() error = %v", err)
+	}
+
+	dst := newTestTable("persist-dst")
+	if err := dst.LoadFrom(&buf); err != nil {
+		t.Fatalf("LoadFrom() error = %v", err)
+	}
+
+	dst.RLock()
+	restored, ok := dst.items["k"]
+	dst.RUnlock()
+	if !ok {
+		t.Fatal("item not restored")
+	}
+	if restored.Data() != "v" {
+		t.Fatalf("Data() = %v, want %q", restored.Data(), "v")
+	}
+	if restored.AccessCount() != 3 {
+		t.Fatalf("AccessCount() = %d, want 3", restored.AccessCount())
+	}
+	if !restored.CreatedOn().Equal(item.CreatedOn()) {
+		t.Fatalf("CreatedOn() = %v, want %v", restored.CreatedOn(), item.CreatedOn())
+	}
+	if !restored.AccessedOn().Equal(item.AccessedOn()) {
+		t.Fatalf("AccessedOn() = %v, want %v", restored.AccessedOn(), item.AccessedOn())
+	}
+	wantDeadline := item.AccessedOn().Add(time.Hour)
+	if gotDeadline := restored.AccessedOn().Add(restored.LifeSpan()); !gotDeadline.Equal(wantDeadline) {
+		t.Fatalf("deadline = %v, want %v", gotDeadline, wantDeadline)
+	}
+}
+
+// Items whose lifespan already elapsed between SaveTo and LoadFrom must be
+// dropped instead of being restored.
+func TestLoadFromDropsExpiredItems(t *testing.T) {
+	src := newTestTable("persist-expired-src")
+	src.Add("expired", 10*time.Millisecond, "v")
+
+	var buf bytes.Buffer
+	if err := src.SaveTo(&buf); err != nil {
+		t.Fatalf("SaveTo() error = %v", err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	dst := newTestTable("persist-expired-dst")
+	if err := dst.LoadFrom(&buf); err != nil {
+		t.Fatalf("LoadFrom() error = %v", err)
+	}
+
+	if dst.Exists("expired") {
+		t.Fatal("LoadFrom restored an item whose lifespan had already elapsed")
+	}
+}
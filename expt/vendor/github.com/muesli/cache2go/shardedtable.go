@@ -0,0 +1,269 @@
+/*
+ * Simple caching library with expiration capabilities
+ *     Copyright (c) 2013, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE.txt
+ */
+
+package cache2go
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ShardedTable is a drop-in replacement for CacheTable that spreads its
+// items across N independent sub-tables, each with its own mutex, items map
+// and expiration timer, to remove the single-mutex contention a busy
+// CacheTable runs into under concurrent Add/Value calls on many keys.
+//ShardedTable把item分散到N个相互独立的子表, 消除单一CacheTable的锁竞争;
+type ShardedTable struct {
+	name   string
+	shards []*CacheTable
+
+	mutex sync.RWMutex
+	// hashKeyFallback hashes keys that aren't one of the common concrete
+	// types stableHash knows about. Nil means hashInterfaceKey's default
+	// (string-representation) fallback is used. Guarded by mutex since
+	// shardFor reads it from every Add/Value/Delete/etc. call.
+	//未知类型key的求哈希兜底函数, nil则用默认兜底; 由mutex保护;
+	hashKeyFallback func(interface{}) uint64
+}
+
+// NewShardedTable creates a ShardedTable with the given number of shards.
+// shards <= 0 is treated as 1, which makes it behave like a single
+// CacheTable.
+//shards<=0按1处理, 此时行为与单个CacheTable等价;
+func NewShardedTable(name string, shards int) *ShardedTable {
+	if shards <= 0 {
+		shards = 1
+	}
+
+	st := &ShardedTable{
+		name:   name,
+		shards: make([]*CacheTable, shards),
+	}
+	for i := range st.shards {
+		st.shards[i] = &CacheTable{
+			name:  fmt.Sprintf("%s-shard%d", name, i),
+			items: make(map[interface{}]*CacheItem),
+		}
+	}
+
+	return st
+}
+
+// SetHashFallback configures the function used to hash keys whose concrete
+// type isn't one of the common ones cache2go already knows how to hash
+// stably (strings, byte slices, int, int32, int64, uint, uint32, uint64). Use this
+// when keys are a custom struct or other arbitrary interface{} type, so
+// that equal keys are always routed to the same shard.
+//自定义key类型的求哈希函数, 确保相等的key总路由到同一分片;
+func (st *ShardedTable) SetHashFallback(f func(interface{}) uint64) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	st.hashKeyFallback = f
+}
+
+func (st *ShardedTable) shardFor(key interface{}) *CacheTable {
+	h, ok := stableHash(key)
+	if !ok {
+		st.mutex.RLock()
+		fallback := st.hashKeyFallback
+		st.mutex.RUnlock()
+
+		if fallback != nil {
+			h = fallback(key)
+		} else {
+			h = hashInterfaceKey(key)
+		}
+	}
+
+	return st.shards[h%uint64(len(st.shards))]
+}
+
+// Add adds a key/value pair to the cache, see CacheTable.Add.
+func (st *ShardedTable) Add(key interface{}, lifeSpan time.Duration, data interface{}) *CacheItem {
+	return st.shardFor(key).Add(key, lifeSpan, data)
+}
+
+// NotFoundAdd adds a key/value pair to the cache if key isn't already
+// present, see CacheTable.NotFoundAdd.
+func (st *ShardedTable) NotFoundAdd(key interface{}, lifeSpan time.Duration, data interface{}) bool {
+	return st.shardFor(key).NotFoundAdd(key, lifeSpan, data)
+}
+
+// Value retrieves an item from the cache, see CacheTable.Value.
+func (st *ShardedTable) Value(key interface{}, args ...interface{}) (*CacheItem, error) {
+	return st.shardFor(key).Value(key, args...)
+}
+
+// Delete removes an item from the cache, see CacheTable.Delete.
+func (st *ShardedTable) Delete(key interface{}) (*CacheItem, error) {
+	return st.shardFor(key).Delete(key)
+}
+
+// Exists tests whether an item exists in the cache, see CacheTable.Exists.
+func (st *ShardedTable) Exists(key interface{}) bool {
+	return st.shardFor(key).Exists(key)
+}
+
+// Count returns how many items are currently stored across all shards.
+//所有分片item总数;
+func (st *ShardedTable) Count() int {
+	count := 0
+	for _, shard := range st.shards {
+		count += shard.Count()
+	}
+	return count
+}
+
+// Flush deletes all items from every shard.
+//清空所有分片;
+func (st *ShardedTable) Flush() {
+	for _, shard := range st.shards {
+		shard.Flush()
+	}
+}
+
+// Foreach fans out over every shard and calls trans for each item found.
+// Unlike CacheTable.Foreach, no single lock is held across the whole call;
+// each shard is merely locked in turn.
+//依次遍历各分片调用trans, 不持有单一的锁;
+func (st *ShardedTable) Foreach(trans func(key interface{}, item *CacheItem)) {
+	for _, shard := range st.shards {
+		shard.Foreach(trans)
+	}
+}
+
+// MostAccessed fans out across all shards and merges the results, returning
+// the count most accessed items overall, see CacheTable.MostAccessed.
+//合并所有分片, 返回整体访问最多的count个item;
+func (st *ShardedTable) MostAccessed(count int64) []*CacheItem {
+	var pairs CacheItemPairList
+	byKey := make(map[interface{}]*CacheItem)
+
+	for _, shard := range st.shards {
+		shard.RLock()
+		for k, v := range shard.items {
+			pairs = append(pairs, CacheItemPair{k, v.accessCount})
+			byKey[k] = v
+		}
+		shard.RUnlock()
+	}
+	sort.Sort(pairs)
+
+	var r []*CacheItem
+	c := int64(0)
+	for _, p := range pairs {
+		if c >= count {
+			break
+		}
+		if item, ok := byKey[p.Key]; ok {
+			r = append(r, item)
+		}
+		c++
+	}
+
+	return r
+}
+
+// SetDataLoader configures a data-loader callback on every shard, see
+// CacheTable.SetDataLoader.
+func (st *ShardedTable) SetDataLoader(f func(interface{}, ...interface{}) *CacheItem) {
+	for _, shard := range st.shards {
+		shard.SetDataLoader(f)
+	}
+}
+
+// SetAddedItemCallback configures an added-item callback on every shard,
+// see CacheTable.SetAddedItemCallback.
+func (st *ShardedTable) SetAddedItemCallback(f func(*CacheItem)) {
+	for _, shard := range st.shards {
+		shard.SetAddedItemCallback(f)
+	}
+}
+
+// SetAboutToDeleteItemCallback configures an about-to-delete callback on
+// every shard, see CacheTable.SetAboutToDeleteItemCallback.
+func (st *ShardedTable) SetAboutToDeleteItemCallback(f func(*CacheItem)) {
+	for _, shard := range st.shards {
+		shard.SetAboutToDeleteItemCallback(f)
+	}
+}
+
+// SetLogger sets the logger used by every shard, see CacheTable.SetLogger.
+func (st *ShardedTable) SetLogger(logger *log.Logger) {
+	for _, shard := range st.shards {
+		shard.SetLogger(logger)
+	}
+}
+
+// SetCapacity bounds how many items each shard may hold, see
+// CacheTable.SetCapacity. Note the limit applies per shard, not across the
+// whole table.
+//设置每个分片的容量上限, 而非整表上限
+func (st *ShardedTable) SetCapacity(n int) {
+	for _, shard := range st.shards {
+		shard.SetCapacity(n)
+	}
+}
+
+// SetEvictionPolicy configures the eviction policy used by every shard,
+// see CacheTable.SetEvictionPolicy. newPolicy is called once per shard so
+// each one gets its own policy instance (e.g. its own LRU list) rather
+// than sharing one, which would both serialize shards on a single mutex
+// and let one shard's recency touches pollute another's ordering. Pass a
+// constructor like NewLRUPolicy, not an already-constructed EvictionPolicy.
+// Pass nil to disable eviction on every shard again, as with
+// CacheTable.SetEvictionPolicy.
+//为每个分片设置淘汰策略; newPolicy对每个分片各调用一次, 确保各分片拥有独立的策略实例,
+//而非共享同一个(否则各分片会在同一把锁上串行, 且彼此的最近访问会相互污染); 传nil关闭淘汰;
+func (st *ShardedTable) SetEvictionPolicy(newPolicy func() EvictionPolicy) {
+	for _, shard := range st.shards {
+		if newPolicy == nil {
+			shard.SetEvictionPolicy(nil)
+			continue
+		}
+		shard.SetEvictionPolicy(newPolicy())
+	}
+}
+
+// SetLoadDeduplication configures loadData deduplication on every shard,
+// see CacheTable.SetLoadDeduplication.
+func (st *ShardedTable) SetLoadDeduplication(enable bool) {
+	for _, shard := range st.shards {
+		shard.SetLoadDeduplication(enable)
+	}
+}
+
+// SetStatsCollector configures a StatsCollector on every shard, see
+// CacheTable.SetStatsCollector. Counters themselves remain per shard; use
+// Stats to read a merged view across all shards.
+//为每个分片设置StatsCollector; 计数器仍按分片独立, 需用Stats获取合并视图
+func (st *ShardedTable) SetStatsCollector(c StatsCollector) {
+	for _, shard := range st.shards {
+		shard.SetStatsCollector(c)
+	}
+}
+
+// Stats returns a merged snapshot of every shard's counters, see
+// CacheTable.Stats.
+//合并所有分片的计数器快照
+func (st *ShardedTable) Stats() Stats {
+	var s Stats
+	for _, shard := range st.shards {
+		shardStats := shard.Stats()
+		s.Hits += shardStats.Hits
+		s.Misses += shardStats.Misses
+		s.Loads += shardStats.Loads
+		s.LoadErrors += shardStats.LoadErrors
+		s.Evictions += shardStats.Evictions
+		s.Expirations += shardStats.Expirations
+		s.Size += shardStats.Size
+	}
+	return s
+}
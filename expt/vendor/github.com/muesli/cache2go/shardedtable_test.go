@@ -0,0 +1,110 @@
+package cache2go
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Run with -race: concurrent Add/Value/Delete against many distinct keys
+// must not race, whether keys route through stableHash or through a
+// concurrently-set hash fallback for an unknown key type.
+func TestShardedTableConcurrentAccess(t *testing.T) {
+	st := NewShardedTable("sharded-concurrent", 8)
+
+	type customKey struct{ n int }
+	st.SetHashFallback(func(k interface{}) uint64 {
+		return uint64(k.(customKey).n)
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			st.Add(fmt.Sprintf("k%d", i), 0, i)
+			st.Value(fmt.Sprintf("k%d", i))
+			st.Add(customKey{i}, 0, i)
+			st.Delete(fmt.Sprintf("k%d", i))
+		}()
+	}
+
+	// SetHashFallback racing against shardFor's reads is the case the
+	// reviewer reproduced; keep reconfiguring it while the above goroutines
+	// are routing keys through it.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			st.SetHashFallback(func(k interface{}) uint64 {
+				return uint64(k.(customKey).n)
+			})
+		}
+	}()
+
+	wg.Wait()
+}
+
+// SetCapacity/SetEvictionPolicy/SetLoadDeduplication/SetStatsCollector must
+// forward to every shard so sharding composes with the other features.
+func TestShardedTableForwardsSetters(t *testing.T) {
+	st := NewShardedTable("sharded-setters", 4)
+
+	st.SetCapacity(1)
+	st.SetEvictionPolicy(NewLRUPolicy)
+	st.SetLoadDeduplication(true)
+
+	var collected int64
+	st.SetStatsCollector(&countingCollector{hits: &collected})
+
+	seenPolicies := make(map[EvictionPolicy]bool)
+	for _, shard := range st.shards {
+		if shard.capacity != 1 {
+			t.Errorf("shard capacity = %d, want 1", shard.capacity)
+		}
+		if shard.policy == nil {
+			t.Error("shard eviction policy not set")
+		}
+		if seenPolicies[shard.policy] {
+			t.Error("two shards share the same EvictionPolicy instance, want one per shard")
+		}
+		seenPolicies[shard.policy] = true
+		if !shard.loadDedup {
+			t.Error("shard load dedup not enabled")
+		}
+		if shard.collector() == nil {
+			t.Error("shard stats collector not set")
+		}
+	}
+}
+
+// SetEvictionPolicy(nil) must disable eviction on every shard again,
+// matching CacheTable.SetEvictionPolicy, instead of panicking on a nil
+// constructor call.
+func TestShardedTableSetEvictionPolicyNilDisables(t *testing.T) {
+	st := NewShardedTable("sharded-setters-nil", 4)
+
+	st.SetEvictionPolicy(NewLRUPolicy)
+	st.SetEvictionPolicy(nil)
+
+	for _, shard := range st.shards {
+		if shard.policy != nil {
+			t.Error("shard eviction policy not disabled by SetEvictionPolicy(nil)")
+		}
+	}
+}
+
+type countingCollector struct {
+	hits *int64
+}
+
+func (c *countingCollector) IncHit()                            { *c.hits++ }
+func (c *countingCollector) IncMiss()                           {}
+func (c *countingCollector) IncLoad()                           {}
+func (c *countingCollector) IncLoadError()                      {}
+func (c *countingCollector) IncEviction()                       {}
+func (c *countingCollector) IncExpiration()                     {}
+func (c *countingCollector) ObserveLoadLatency(d time.Duration) {}
+func (c *countingCollector) SetSize(n int)                      {}
@@ -0,0 +1,152 @@
+/*
+ * Simple caching library with expiration capabilities
+ *     Copyright (c) 2013, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE.txt
+ */
+
+package cache2go
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of a CacheTable's running counters, as returned by
+// Stats().
+//Stats()返回的计数器快照;
+type Stats struct {
+	// Number of Value calls that found the key already in the cache.
+	Hits int64
+	// Number of Value calls that didn't find the key in the cache.
+	Misses int64
+	// Number of times the data-loader callback was invoked.
+	Loads int64
+	// Number of data-loader invocations that returned nil.
+	LoadErrors int64
+	// Number of items removed by an EvictionPolicy to make room for a
+	// new one.
+	Evictions int64
+	// Number of items removed because their lifespan elapsed.
+	Expirations int64
+	// Current number of items in the table.
+	Size int64
+}
+
+// StatsCollector lets a CacheTable bridge its counters to an external
+// metrics system (Prometheus, OpenTelemetry, expvar, ...) without this
+// package importing any of them. All methods are called without the
+// table's lock held, so implementations must be safe for concurrent use.
+//桥接到外部指标系统的接口; 方法均在不持有表锁时调用, 实现需并发安全;
+type StatsCollector interface {
+	// IncHit is called every time Value finds the key already cached.
+	IncHit()
+	// IncMiss is called every time Value doesn't find the key cached.
+	IncMiss()
+	// IncLoad is called every time the data-loader callback runs.
+	IncLoad()
+	// IncLoadError is called every time the data-loader callback
+	// returns nil.
+	IncLoadError()
+	// IncEviction is called every time an EvictionPolicy removes an
+	// item to make room for a new one.
+	IncEviction()
+	// IncExpiration is called every time an item is removed because
+	// its lifespan elapsed.
+	IncExpiration()
+	// ObserveLoadLatency is called with how long the data-loader
+	// callback took to run.
+	ObserveLoadLatency(d time.Duration)
+	// SetSize is called whenever the table's item count changes.
+	SetSize(n int)
+}
+
+// statsCollectorBox wraps a StatsCollector so it can be stored in an
+// atomic.Value: the interface's dynamic type varies across callers, and
+// atomic.Value panics if consecutive Store calls don't share one
+// concrete type, so a stable wrapper type is stored instead.
+type statsCollectorBox struct {
+	c StatsCollector
+}
+
+// SetStatsCollector configures a StatsCollector to be notified alongside
+// this table's own counters (see Stats). Pass nil to stop notifying an
+// external system.
+//配置StatsCollector, 传入nil停止向外部系统通知;
+func (table *CacheTable) SetStatsCollector(c StatsCollector) {
+	table.statsCollector.Store(&statsCollectorBox{c: c})
+}
+
+// collector returns the currently configured StatsCollector, or nil if
+// none is set. Safe to call without the table lock held.
+func (table *CacheTable) collector() StatsCollector {
+	v, _ := table.statsCollector.Load().(*statsCollectorBox)
+	if v == nil {
+		return nil
+	}
+	return v.c
+}
+
+// Stats returns a snapshot of this table's hit/miss/load/eviction/
+// expiration counters and current size.
+//返回本表各计数器及当前大小的快照;
+func (table *CacheTable) Stats() Stats {
+	return Stats{
+		Hits:        atomic.LoadInt64(&table.statsHits),
+		Misses:      atomic.LoadInt64(&table.statsMisses),
+		Loads:       atomic.LoadInt64(&table.statsLoads),
+		LoadErrors:  atomic.LoadInt64(&table.statsLoadErrors),
+		Evictions:   atomic.LoadInt64(&table.statsEvictions),
+		Expirations: atomic.LoadInt64(&table.statsExpirations),
+		Size:        atomic.LoadInt64(&table.statsSize),
+	}
+}
+
+func (table *CacheTable) recordHit() {
+	atomic.AddInt64(&table.statsHits, 1)
+	if c := table.collector(); c != nil {
+		c.IncHit()
+	}
+}
+
+func (table *CacheTable) recordMiss() {
+	atomic.AddInt64(&table.statsMisses, 1)
+	if c := table.collector(); c != nil {
+		c.IncMiss()
+	}
+}
+
+func (table *CacheTable) recordLoad(latency time.Duration, success bool) {
+	atomic.AddInt64(&table.statsLoads, 1)
+	if !success {
+		atomic.AddInt64(&table.statsLoadErrors, 1)
+	}
+	if c := table.collector(); c != nil {
+		c.IncLoad()
+		c.ObserveLoadLatency(latency)
+		if !success {
+			c.IncLoadError()
+		}
+	}
+}
+
+func (table *CacheTable) recordEviction() {
+	atomic.AddInt64(&table.statsEvictions, 1)
+	if c := table.collector(); c != nil {
+		c.IncEviction()
+	}
+}
+
+func (table *CacheTable) recordExpiration() {
+	atomic.AddInt64(&table.statsExpirations, 1)
+	if c := table.collector(); c != nil {
+		c.IncExpiration()
+	}
+}
+
+func (table *CacheTable) recordSizeDelta(delta int64) {
+	size := atomic.AddInt64(&table.statsSize, delta)
+	if c := table.collector(); c != nil {
+		c.SetSize(int(size))
+	}
+}
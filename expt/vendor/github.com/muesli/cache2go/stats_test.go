@@ -0,0 +1,105 @@
+package cache2go
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+type nopStatsCollector struct{}
+
+func (nopStatsCollector) IncHit()                            {}
+func (nopStatsCollector) IncMiss()                           {}
+func (nopStatsCollector) IncLoad()                           {}
+func (nopStatsCollector) IncLoadError()                      {}
+func (nopStatsCollector) IncEviction()                       {}
+func (nopStatsCollector) IncExpiration()                     {}
+func (nopStatsCollector) ObserveLoadLatency(d time.Duration) {}
+func (nopStatsCollector) SetSize(n int)                      {}
+
+// Run with -race: SetStatsCollector runs concurrently with Value, which
+// reads the collector outside the table lock from recordHit/recordMiss.
+func TestSetStatsCollectorConcurrentWithValue(t *testing.T) {
+	table := newTestTable("stats-race")
+	table.Add("k", 0, "v")
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			table.SetStatsCollector(nopStatsCollector{})
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			table.Value("k")
+		}
+	}()
+
+	wg.Wait()
+}
+
+// Re-Adding the same key must not count as a new item: Stats().Size tracks
+// how many distinct keys are in the table, which Count() also reports.
+func TestAddOverwriteDoesNotInflateSize(t *testing.T) {
+	table := newTestTable("stats-size-overwrite")
+
+	table.Add("k", 0, "v1")
+	table.Add("k", 0, "v2")
+	table.Add("k", 0, "v3")
+
+	if count := table.Count(); count != 1 {
+		t.Fatalf("Count() = %d, want 1", count)
+	}
+	if size := table.Stats().Size; size != 1 {
+		t.Fatalf("Stats().Size = %d, want 1 (re-Add of an existing key must not inflate it)", size)
+	}
+}
+
+// callbackCollector calls back into the table from IncEviction/SetSize, the
+// way a real collector logging Count() on eviction would. If those methods
+// ran with the table lock still held, this would deadlock since
+// sync.RWMutex isn't reentrant.
+type callbackCollector struct {
+	nopStatsCollector
+	table *CacheTable
+}
+
+func (c *callbackCollector) IncEviction() {
+	c.table.Count()
+}
+
+func (c *callbackCollector) SetSize(n int) {
+	c.table.Count()
+}
+
+// Run with -race and a timeout: a StatsCollector that calls back into the
+// table from IncEviction (fired when Add evicts to make room) or SetSize
+// (fired by Flush) must not deadlock, per StatsCollector's documented
+// contract that its methods run without the table lock held.
+func TestStatsCollectorCallbackDoesNotDeadlockOnEviction(t *testing.T) {
+	table := newTestTable("stats-eviction-callback")
+	table.SetEvictionPolicy(NewLRUPolicy())
+	table.SetCapacity(1)
+
+	collector := &callbackCollector{table: table}
+	table.SetStatsCollector(collector)
+
+	table.Add("k1", 0, "v1")
+	done := make(chan struct{})
+	go func() {
+		table.Add("k2", 0, "v2") // evicts k1, firing IncEviction
+		table.Flush()            // fires SetSize(0)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("deadlocked: StatsCollector callback ran with the table lock held")
+	}
+}